@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2014, Psiphon Inc.
+ * All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Backoff implements a jittered exponential backoff schedule, unifying
+// the reconnection/retry logic used by tunnel dialing code. Each call to
+// NextDelay multiplies the previous delay by multiplier, caps it at max,
+// and applies Jitter with jitterFactor so that many concurrent callers
+// don't retry in lockstep.
+type Backoff struct {
+	mutex        sync.Mutex
+	initial      time.Duration
+	max          time.Duration
+	multiplier   float64
+	jitterFactor float64
+	current      time.Duration
+}
+
+// NewBackoff creates a Backoff starting at initial and capped at max,
+// growing by multiplier on each call to NextDelay and jittered by
+// jitterFactor (see Jitter).
+func NewBackoff(initial, max time.Duration, multiplier, jitterFactor float64) *Backoff {
+	return &Backoff{
+		initial:      initial,
+		max:          max,
+		multiplier:   multiplier,
+		jitterFactor: jitterFactor,
+	}
+}
+
+// NextDelay returns the next delay in the backoff schedule and advances
+// the schedule for the following call.
+func (b *Backoff) NextDelay() time.Duration {
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.current == 0 {
+		b.current = b.initial
+	} else {
+		b.current = time.Duration(float64(b.current) * b.multiplier)
+		if b.current > b.max {
+			b.current = b.max
+		}
+	}
+
+	return time.Duration(Jitter(int64(b.current), b.jitterFactor))
+}
+
+// Reset returns the schedule to its initial state.
+func (b *Backoff) Reset() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.current = 0
+}
+
+// Sleep waits for the next delay in the schedule, or returns early with
+// ctx's error if ctx is done first.
+func (b *Backoff) Sleep(ctx context.Context) error {
+	timer := time.NewTimer(b.NextDelay())
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Retry repeatedly invokes op, sleeping on this Backoff's schedule between
+// attempts, until op succeeds, ctx is done, or classify reports that a
+// returned error should not be retried. Retry returns the last error
+// returned by op, or ctx's error if ctx is done while waiting to retry.
+func (b *Backoff) Retry(
+	ctx context.Context,
+	op func() error,
+	classify func(error) (retry bool)) error {
+
+	for {
+		err := op()
+		if err == nil {
+			return nil
+		}
+
+		if !classify(err) {
+			return err
+		}
+
+		if sleepErr := b.Sleep(ctx); sleepErr != nil {
+			return sleepErr
+		}
+	}
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2014, Psiphon Inc.
+ * All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoffNextDelayEnvelope(t *testing.T) {
+
+	initial := 100 * time.Millisecond
+	max := 1 * time.Second
+	multiplier := 2.0
+	jitterFactor := 0.1
+
+	b := NewBackoff(initial, max, multiplier, jitterFactor)
+
+	previous := time.Duration(0)
+	expected := initial
+	for i := 0; i < 10; i++ {
+
+		expectedMin := time.Duration(float64(expected) * (1 - jitterFactor))
+		expectedMax := time.Duration(float64(expected) * (1 + jitterFactor))
+
+		for n := 0; n < 1000; n++ {
+			// Prime the schedule to the state it would be in just before
+			// this step, so repeated sampling can probe the same step's
+			// jitter envelope.
+			b.mutex.Lock()
+			b.current = previous
+			b.mutex.Unlock()
+
+			d := b.NextDelay()
+			if d < expectedMin || d > expectedMax {
+				t.Errorf("delay %s out of envelope [%s, %s] at step %d", d, expectedMin, expectedMax, i)
+			}
+		}
+
+		previous = expected
+		expected = time.Duration(float64(expected) * multiplier)
+		if expected > max {
+			expected = max
+		}
+	}
+}
+
+func TestBackoffReset(t *testing.T) {
+
+	b := NewBackoff(100*time.Millisecond, 1*time.Second, 2.0, 0.1)
+
+	first := b.NextDelay()
+	b.NextDelay()
+	b.NextDelay()
+
+	b.Reset()
+
+	afterReset := b.NextDelay()
+
+	// After Reset, the next delay should again fall within the initial
+	// step's envelope, not the grown schedule's.
+	if afterReset > first*2 {
+		t.Errorf("expected delay near initial after Reset, got %s (first was %s)", afterReset, first)
+	}
+}
+
+func TestBackoffSleepContextCancellation(t *testing.T) {
+
+	b := NewBackoff(1*time.Hour, 1*time.Hour, 2.0, 0.1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := b.Sleep(ctx)
+	if err == nil {
+		t.Error("expected Sleep to return early with context error")
+	}
+}
+
+func TestBackoffRetry(t *testing.T) {
+
+	b := NewBackoff(1*time.Millisecond, 10*time.Millisecond, 2.0, 0.1)
+
+	attempts := 0
+	err := b.Retry(
+		context.Background(),
+		func() error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("transient")
+			}
+			return nil
+		},
+		func(err error) bool { return true })
+
+	if err != nil {
+		t.Errorf("expected Retry to succeed, got: %s", err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestBackoffRetryNonRetryableError(t *testing.T) {
+
+	b := NewBackoff(1*time.Millisecond, 10*time.Millisecond, 2.0, 0.1)
+
+	permanentErr := errors.New("permanent")
+
+	attempts := 0
+	err := b.Retry(
+		context.Background(),
+		func() error {
+			attempts++
+			return permanentErr
+		},
+		func(err error) bool { return false })
+
+	if err != permanentErr {
+		t.Errorf("expected permanent error to be returned, got: %s", err)
+	}
+	if attempts != 1 {
+		t.Errorf("expected exactly 1 attempt, got %d", attempts)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2014, Psiphon Inc.
+ * All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionAlgo identifies the compression algorithm used by
+// CompressStream/DecompressStream.
+type CompressionAlgo int
+
+const (
+	// CompressZlib is the existing Compress/Decompress algorithm. It has
+	// no magic header of its own; it's identified by its well-known 0x78
+	// first byte, preserving backward compatibility with blobs produced
+	// by Compress.
+	CompressZlib CompressionAlgo = iota
+
+	// CompressGzip and CompressZstd are newer algorithms, each identified
+	// by a single magic byte prepended to the stream.
+	CompressGzip
+	CompressZstd
+)
+
+// Magic bytes identifying CompressGzip and CompressZstd streams. 0x78 is
+// reserved, as it's the first byte of a zlib stream produced by Compress.
+const (
+	compressStreamMagicGzip byte = 0x01
+	compressStreamMagicZstd byte = 0x02
+)
+
+// CompressStream returns an io.WriteCloser which compresses data written
+// to it with algo and writes the result to w. Closing the returned writer
+// flushes any buffered data and must not be omitted. Unlike Compress,
+// which operates on a whole in-memory blob, CompressStream is suitable
+// for large payloads, such as diagnostic bundles or server list packs,
+// that shouldn't require full buffering.
+func CompressStream(w io.Writer, algo CompressionAlgo) (io.WriteCloser, error) {
+
+	switch algo {
+
+	case CompressZlib:
+		return zlib.NewWriter(w), nil
+
+	case CompressGzip:
+		if _, err := w.Write([]byte{compressStreamMagicGzip}); err != nil {
+			return nil, fmt.Errorf("write magic failed: %s", err)
+		}
+		return gzip.NewWriter(w), nil
+
+	case CompressZstd:
+		if _, err := w.Write([]byte{compressStreamMagicZstd}); err != nil {
+			return nil, fmt.Errorf("write magic failed: %s", err)
+		}
+		return zstd.NewWriter(w)
+	}
+
+	return nil, fmt.Errorf("unknown compression algorithm: %d", algo)
+}
+
+// DecompressStream returns an io.ReadCloser which decompresses data read
+// from r. The algorithm is auto-detected from r's first byte: 0x78 is
+// treated as a zlib stream, for backward compatibility with blobs
+// produced by Compress/CompressStream(..., CompressZlib); otherwise the
+// first byte is consumed as a CompressStream magic byte identifying the
+// algorithm. The caller must Close the returned reader to release the
+// underlying decoder's resources, notably CompressZstd's background
+// goroutines and buffers.
+func DecompressStream(r io.Reader) (io.ReadCloser, error) {
+
+	buffered := bufio.NewReader(r)
+
+	first, err := buffered.Peek(1)
+	if err != nil {
+		return nil, fmt.Errorf("peek magic failed: %s", err)
+	}
+
+	if first[0] == 0x78 {
+		return zlib.NewReader(buffered)
+	}
+
+	// Consume the magic byte; it's not part of the underlying algorithm's
+	// stream.
+	if _, err := buffered.Discard(1); err != nil {
+		return nil, fmt.Errorf("discard magic failed: %s", err)
+	}
+
+	switch first[0] {
+
+	case compressStreamMagicGzip:
+		return gzip.NewReader(buffered)
+
+	case compressStreamMagicZstd:
+		decoder, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+
+	return nil, fmt.Errorf("unknown compression magic: %#x", first[0])
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2014, Psiphon Inc.
+ * All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+var compressStreamTestAlgos = []CompressionAlgo{CompressZlib, CompressGzip, CompressZstd}
+
+func TestCompressDecompressStream(t *testing.T) {
+
+	originalData := []byte("test data, repeated for compressibility: " +
+		"test data, repeated for compressibility: " +
+		"test data, repeated for compressibility:")
+
+	for _, algo := range compressStreamTestAlgos {
+
+		var compressed bytes.Buffer
+
+		writer, err := CompressStream(&compressed, algo)
+		if err != nil {
+			t.Fatalf("CompressStream failed for algo %d: %s", algo, err)
+		}
+		if _, err := writer.Write(originalData); err != nil {
+			t.Fatalf("Write failed for algo %d: %s", algo, err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("Close failed for algo %d: %s", algo, err)
+		}
+
+		reader, err := DecompressStream(&compressed)
+		if err != nil {
+			t.Fatalf("DecompressStream failed for algo %d: %s", algo, err)
+		}
+
+		decompressedData, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("ReadAll failed for algo %d: %s", algo, err)
+		}
+
+		if err := reader.Close(); err != nil {
+			t.Fatalf("Close failed for algo %d: %s", algo, err)
+		}
+
+		if !bytes.Equal(originalData, decompressedData) {
+			t.Errorf("decompressed data doesn't match original data for algo %d", algo)
+		}
+	}
+}
+
+func TestDecompressStreamBackwardCompatibleWithCompress(t *testing.T) {
+
+	originalData := []byte("test data")
+
+	compressedData := Compress(originalData)
+
+	reader, err := DecompressStream(bytes.NewReader(compressedData))
+	if err != nil {
+		t.Fatalf("DecompressStream failed: %s", err)
+	}
+
+	decompressedData, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %s", err)
+	}
+
+	if err := reader.Close(); err != nil {
+		t.Fatalf("Close failed: %s", err)
+	}
+
+	if !bytes.Equal(originalData, decompressedData) {
+		t.Error("decompressed data doesn't match original data")
+	}
+}
+
+func benchmarkCompressPayload(b *testing.B, algo CompressionAlgo, size int) {
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), size/16+1)[:size]
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var compressed bytes.Buffer
+		writer, err := CompressStream(&compressed, algo)
+		if err != nil {
+			b.Fatalf("CompressStream failed: %s", err)
+		}
+		if _, err := writer.Write(data); err != nil {
+			b.Fatalf("Write failed: %s", err)
+		}
+		if err := writer.Close(); err != nil {
+			b.Fatalf("Close failed: %s", err)
+		}
+	}
+}
+
+func BenchmarkCompressZlib1K(b *testing.B) { benchmarkCompressPayload(b, CompressZlib, 1024) }
+func BenchmarkCompressGzip1K(b *testing.B) { benchmarkCompressPayload(b, CompressGzip, 1024) }
+func BenchmarkCompressZstd1K(b *testing.B) { benchmarkCompressPayload(b, CompressZstd, 1024) }
+func BenchmarkCompressZlib1M(b *testing.B) { benchmarkCompressPayload(b, CompressZlib, 1024*1024) }
+func BenchmarkCompressGzip1M(b *testing.B) { benchmarkCompressPayload(b, CompressGzip, 1024*1024) }
+func BenchmarkCompressZstd1M(b *testing.B) { benchmarkCompressPayload(b, CompressZstd, 1024*1024) }
@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) 2014, Psiphon Inc.
+ * All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// HASH_DRBG_SEED_LENGTH is the required seed size, in bytes, for NewHashDRBG.
+const HASH_DRBG_SEED_LENGTH = 24
+
+// HashDRBG is a seeded, deterministic pseudo-random source backed by
+// SHA-256 in counter mode. Given the same seed, a HashDRBG produces the
+// same output stream, which allows two peers of a tunnel to derive
+// identical padding/jitter/permutation schedules from a shared handshake
+// secret. HashDRBG is not a CSPRNG replacement and must not be used for
+// generating keys or other security-sensitive secrets; use
+// MakeSecureRandomPerm/MakeSecureRandomRange/MakeSecureRandomPeriod for
+// those cases. HashDRBG is safe for concurrent use.
+type HashDRBG struct {
+	mutex   sync.Mutex
+	seed    [HASH_DRBG_SEED_LENGTH]byte
+	counter uint64
+	buffer  []byte
+}
+
+// NewHashDRBG creates a HashDRBG from the given seed, which must be
+// HASH_DRBG_SEED_LENGTH bytes long.
+func NewHashDRBG(seed []byte) (*HashDRBG, error) {
+	drbg := new(HashDRBG)
+	if err := drbg.Reseed(seed); err != nil {
+		return nil, err
+	}
+	return drbg, nil
+}
+
+// Reseed resets the DRBG to its initial state using the given seed, which
+// must be HASH_DRBG_SEED_LENGTH bytes long.
+func (drbg *HashDRBG) Reseed(seed []byte) error {
+	if len(seed) != HASH_DRBG_SEED_LENGTH {
+		return fmt.Errorf("invalid HashDRBG seed length: %d", len(seed))
+	}
+	drbg.mutex.Lock()
+	defer drbg.mutex.Unlock()
+	copy(drbg.seed[:], seed)
+	drbg.counter = 0
+	drbg.buffer = nil
+	return nil
+}
+
+// Read implements io.Reader, filling p with DRBG output. Read always
+// returns len(p), nil.
+func (drbg *HashDRBG) Read(p []byte) (int, error) {
+	drbg.mutex.Lock()
+	defer drbg.mutex.Unlock()
+	n := 0
+	for n < len(p) {
+		if len(drbg.buffer) == 0 {
+			drbg.refill()
+		}
+		c := copy(p[n:], drbg.buffer)
+		drbg.buffer = drbg.buffer[c:]
+		n += c
+	}
+	return n, nil
+}
+
+// refill hashes seed || counter to produce the next block of output bytes,
+// incrementing counter so that each block is distinct.
+func (drbg *HashDRBG) refill() {
+	var counterBytes [8]byte
+	binary.BigEndian.PutUint64(counterBytes[:], drbg.counter)
+	drbg.counter++
+	h := sha256.New()
+	h.Write(drbg.seed[:])
+	h.Write(counterBytes[:])
+	drbg.buffer = h.Sum(nil)
+}
+
+// nextUint64 returns the next 8 bytes of DRBG output as a uint64.
+func (drbg *HashDRBG) nextUint64() uint64 {
+	var b [8]byte
+	drbg.Read(b[:])
+	return binary.BigEndian.Uint64(b[:])
+}
+
+// Intn returns a deterministic pseudo-random int in [0, n). It panics if
+// n <= 0.
+func (drbg *HashDRBG) Intn(n int) int {
+	if n <= 0 {
+		panic("common.HashDRBG.Intn: invalid argument")
+	}
+	return int(drbg.nextUint64() % uint64(n))
+}
+
+// Perm returns a deterministic pseudo-random permutation of the integers
+// [0, n), using a Fisher-Yates shuffle driven by the DRBG.
+func (drbg *HashDRBG) Perm(n int) []int {
+	permutation := make([]int, n)
+	for i := 1; i < n; i++ {
+		j := drbg.Intn(i + 1)
+		permutation[i] = permutation[j]
+		permutation[j] = i
+	}
+	return permutation
+}
+
+// Range returns a deterministic pseudo-random int in [min, max].
+func (drbg *HashDRBG) Range(min, max int) int {
+	return min + drbg.Intn(max-min+1)
+}
+
+// Period returns a deterministic pseudo-random duration in [min, max].
+func (drbg *HashDRBG) Period(min, max time.Duration) time.Duration {
+	return min + time.Duration(drbg.Intn(int(max-min+1)))
+}
+
+// WeightedCoin returns true with the given probability, deterministically
+// derived from the DRBG.
+func (drbg *HashDRBG) WeightedCoin(weight float64) bool {
+	if weight <= 0.0 {
+		return false
+	}
+	if weight >= 1.0 {
+		return true
+	}
+	// 53 bits of precision is sufficient for a float64 mantissa.
+	const precision = 1 << 53
+	return float64(drbg.nextUint64()%precision)/float64(precision) < weight
+}
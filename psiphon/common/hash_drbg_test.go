@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) 2014, Psiphon Inc.
+ * All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"bytes"
+	"testing"
+)
+
+func makeTestSeed(b byte) []byte {
+	seed := make([]byte, HASH_DRBG_SEED_LENGTH)
+	for i := range seed {
+		seed[i] = b
+	}
+	return seed
+}
+
+func TestHashDRBGDeterministic(t *testing.T) {
+
+	seed := makeTestSeed(1)
+
+	drbg1, err := NewHashDRBG(seed)
+	if err != nil {
+		t.Fatalf("NewHashDRBG failed: %s", err)
+	}
+
+	drbg2, err := NewHashDRBG(seed)
+	if err != nil {
+		t.Fatalf("NewHashDRBG failed: %s", err)
+	}
+
+	buf1 := make([]byte, 1000)
+	buf2 := make([]byte, 1000)
+
+	drbg1.Read(buf1)
+	drbg2.Read(buf2)
+
+	if !bytes.Equal(buf1, buf2) {
+		t.Error("expected identical output from identical seeds")
+	}
+
+	drbgOther, err := NewHashDRBG(makeTestSeed(2))
+	if err != nil {
+		t.Fatalf("NewHashDRBG failed: %s", err)
+	}
+
+	bufOther := make([]byte, 1000)
+	drbgOther.Read(bufOther)
+
+	if bytes.Equal(buf1, bufOther) {
+		t.Error("expected different output from different seeds")
+	}
+}
+
+func TestHashDRBGReseed(t *testing.T) {
+
+	drbg, err := NewHashDRBG(makeTestSeed(1))
+	if err != nil {
+		t.Fatalf("NewHashDRBG failed: %s", err)
+	}
+
+	buf1 := make([]byte, 100)
+	drbg.Read(buf1)
+
+	err = drbg.Reseed(makeTestSeed(1))
+	if err != nil {
+		t.Fatalf("Reseed failed: %s", err)
+	}
+
+	buf2 := make([]byte, 100)
+	drbg.Read(buf2)
+
+	if !bytes.Equal(buf1, buf2) {
+		t.Error("expected reseed to reset output stream")
+	}
+
+	err = drbg.Reseed(make([]byte, HASH_DRBG_SEED_LENGTH-1))
+	if err == nil {
+		t.Error("expected Reseed to fail with invalid seed length")
+	}
+}
+
+func TestHashDRBGPerm(t *testing.T) {
+
+	drbg, err := NewHashDRBG(makeTestSeed(3))
+	if err != nil {
+		t.Fatalf("NewHashDRBG failed: %s", err)
+	}
+
+	for n := 0; n < 1000; n++ {
+		perm := drbg.Perm(n)
+		if len(perm) != n {
+			t.Error("unexpected permutation size")
+		}
+		sum := 0
+		seen := make(map[int]bool)
+		for i := 0; i < n; i++ {
+			if seen[perm[i]] {
+				t.Error("duplicate value in permutation")
+			}
+			seen[perm[i]] = true
+			sum += perm[i]
+		}
+		expectedSum := (n * (n - 1)) / 2
+		if sum != expectedSum {
+			t.Error("unexpected permutation")
+		}
+	}
+}
+
+func TestHashDRBGRange(t *testing.T) {
+
+	drbg, err := NewHashDRBG(makeTestSeed(4))
+	if err != nil {
+		t.Fatalf("NewHashDRBG failed: %s", err)
+	}
+
+	min := 1
+	max := 19
+	var gotMin, gotMax bool
+	for n := 0; n < 1000; n++ {
+		i := drbg.Range(min, max)
+		if i < min || i > max {
+			t.Error("out of range")
+		}
+		if i == min {
+			gotMin = true
+		}
+		if i == max {
+			gotMax = true
+		}
+	}
+	if !gotMin {
+		t.Error("missing min")
+	}
+	if !gotMax {
+		t.Error("missing max")
+	}
+}
+
+func TestHashDRBGWeightedCoin(t *testing.T) {
+
+	drbg, err := NewHashDRBG(makeTestSeed(5))
+	if err != nil {
+		t.Fatalf("NewHashDRBG failed: %s", err)
+	}
+
+	runs := 100000
+	tolerance := 1000
+
+	trues := 0
+	for i := 0; i < runs; i++ {
+		if drbg.WeightedCoin(0.5) {
+			trues++
+		}
+	}
+
+	min := runs/2 - tolerance
+	max := runs/2 + tolerance
+	if trues < min || trues > max {
+		t.Errorf("unexpected coin flip outcome: %d", trues)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2014, Psiphon Inc.
+ * All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"container/list"
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// ReplayFilter is a time-bounded set of digests, used by obfs-style
+// transports to reject replayed client handshakes. Digests are computed
+// with SipHash-2-4, keyed with a random key generated once per process,
+// so an adversary cannot predict which buffers will collide. Entries are
+// evicted, on the next TestAndSet, once they've been held for the filter's
+// TTL.
+type ReplayFilter struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	key     [16]byte
+	digests map[uint64]*list.Element
+	order   *list.List
+}
+
+type replayFilterEntry struct {
+	digest    uint64
+	expiresAt time.Time
+}
+
+// NewReplayFilter creates a ReplayFilter that retains each inserted digest
+// for ttl before it is eligible for eviction.
+func NewReplayFilter(ttl time.Duration) *ReplayFilter {
+	var key [16]byte
+	// If the system CSPRNG fails, proceeding with a zero key still yields
+	// a functional, if less unpredictable, filter; there's no sensible
+	// fallback short of panicking, which replay filtering doesn't warrant.
+	rand.Read(key[:])
+	return &ReplayFilter{
+		ttl:     ttl,
+		key:     key,
+		digests: make(map[uint64]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// TestAndSet records buf's digest and reports whether that digest was
+// already present and not yet expired. It is safe for concurrent use.
+func (f *ReplayFilter) TestAndSet(now time.Time, buf []byte) bool {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.evict(now)
+
+	digest := sipHash24(f.key, buf)
+
+	if _, ok := f.digests[digest]; ok {
+		return true
+	}
+
+	element := f.order.PushBack(&replayFilterEntry{
+		digest:    digest,
+		expiresAt: now.Add(f.ttl),
+	})
+	f.digests[digest] = element
+
+	return false
+}
+
+// evict removes entries whose TTL has elapsed as of now. It must be
+// called with f.mutex held.
+func (f *ReplayFilter) evict(now time.Time) {
+	for {
+		front := f.order.Front()
+		if front == nil {
+			return
+		}
+		entry := front.Value.(*replayFilterEntry)
+		if entry.expiresAt.After(now) {
+			return
+		}
+		f.order.Remove(front)
+		delete(f.digests, entry.digest)
+	}
+}
+
+// sipHash24 computes the SipHash-2-4 digest of data keyed with key, per
+// https://131002.net/siphash/siphash.pdf.
+func sipHash24(key [16]byte, data []byte) uint64 {
+
+	k0 := binary.LittleEndian.Uint64(key[0:8])
+	k1 := binary.LittleEndian.Uint64(key[8:16])
+
+	v0 := k0 ^ 0x736f6d6570736575
+	v1 := k1 ^ 0x646f72616e646f6d
+	v2 := k0 ^ 0x6c7967656e657261
+	v3 := k1 ^ 0x7465646279746573
+
+	round := func() {
+		v0 += v1
+		v1 = (v1 << 13) | (v1 >> (64 - 13))
+		v1 ^= v0
+		v0 = (v0 << 32) | (v0 >> (64 - 32))
+		v2 += v3
+		v3 = (v3 << 16) | (v3 >> (64 - 16))
+		v3 ^= v2
+		v0 += v3
+		v3 = (v3 << 21) | (v3 >> (64 - 21))
+		v3 ^= v0
+		v2 += v1
+		v1 = (v1 << 17) | (v1 >> (64 - 17))
+		v1 ^= v2
+		v2 = (v2 << 32) | (v2 >> (64 - 32))
+	}
+
+	length := len(data)
+	end := length - (length % 8)
+
+	for i := 0; i < end; i += 8 {
+		m := binary.LittleEndian.Uint64(data[i : i+8])
+		v3 ^= m
+		round()
+		round()
+		v0 ^= m
+	}
+
+	var last [8]byte
+	copy(last[:], data[end:])
+	last[7] = byte(length)
+	m := binary.LittleEndian.Uint64(last[:])
+
+	v3 ^= m
+	round()
+	round()
+	v0 ^= m
+
+	v2 ^= 0xff
+	round()
+	round()
+	round()
+	round()
+
+	return v0 ^ v1 ^ v2 ^ v3
+}
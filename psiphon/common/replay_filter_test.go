@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2014, Psiphon Inc.
+ * All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReplayFilterHitAndMiss(t *testing.T) {
+
+	filter := NewReplayFilter(1 * time.Minute)
+
+	now := time.Now()
+
+	if filter.TestAndSet(now, []byte("handshake-1")) {
+		t.Error("unexpected hit on first insertion")
+	}
+
+	if !filter.TestAndSet(now, []byte("handshake-1")) {
+		t.Error("expected hit on duplicate buffer")
+	}
+
+	if filter.TestAndSet(now, []byte("handshake-2")) {
+		t.Error("unexpected hit on distinct buffer")
+	}
+}
+
+func TestReplayFilterExpiry(t *testing.T) {
+
+	ttl := 10 * time.Second
+	filter := NewReplayFilter(ttl)
+
+	start := time.Now()
+
+	if filter.TestAndSet(start, []byte("handshake")) {
+		t.Error("unexpected hit on first insertion")
+	}
+
+	if !filter.TestAndSet(start.Add(ttl/2), []byte("handshake")) {
+		t.Error("expected hit within TTL window")
+	}
+
+	if filter.TestAndSet(start.Add(ttl+time.Second), []byte("handshake")) {
+		t.Error("expected miss after TTL has elapsed")
+	}
+}
+
+func TestReplayFilterConcurrent(t *testing.T) {
+
+	filter := NewReplayFilter(1 * time.Minute)
+
+	var wg sync.WaitGroup
+	hits := make([]int32, 100)
+
+	for i := 0; i < 100; i++ {
+		for j := 0; j < 10; j++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				buf := []byte(fmt.Sprintf("buf-%d", i))
+				if filter.TestAndSet(time.Now(), buf) {
+					atomic.AddInt32(&hits[i], 1)
+				}
+			}(i)
+		}
+	}
+
+	wg.Wait()
+
+	// Each distinct buffer is inserted by 10 concurrent goroutines; exactly
+	// 9 of those attempts should observe a prior insertion as a hit.
+	for i, h := range hits {
+		if h != 9 {
+			t.Errorf("buffer %d: expected 9 hits, got %d", i, h)
+		}
+	}
+}
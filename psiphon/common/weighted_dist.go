@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2014, Psiphon Inc.
+ * All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"fmt"
+	"sort"
+)
+
+// WeightedDist samples integers in [min, max] according to a private,
+// seeded weight distribution, similar to what obfs4-style transports use
+// for packet length and inter-arrival gap sampling. The distribution, and
+// the samples drawn from it, are derived from a HashDRBG, so two peers
+// that share the same seed draw the same sequence of values, while an
+// outside observer cannot predict which values are favoured.
+type WeightedDist struct {
+	min    int
+	max    int
+	biased bool
+	rng    *HashDRBG
+	values []int
+	cdf    []float64
+}
+
+// NewWeightedDist creates a WeightedDist sampling values in [min, max].
+// Weights for each value are drawn from rng; if biased is true, weights
+// are squared before normalization, concentrating sampling mass on a few
+// buckets. The mapping from values to weights is itself permuted via rng
+// so that which buckets are "heavy" is not predictable from min/max/biased
+// alone.
+func NewWeightedDist(min, max int, biased bool, rng *HashDRBG) (*WeightedDist, error) {
+	dist := &WeightedDist{
+		min:    min,
+		max:    max,
+		biased: biased,
+	}
+	if err := dist.Reset(rng); err != nil {
+		return nil, err
+	}
+	return dist, nil
+}
+
+// Reset regenerates the distribution's weights using rng, and retains rng
+// as the source for subsequent Sample calls.
+func (dist *WeightedDist) Reset(rng *HashDRBG) error {
+
+	if dist.max < dist.min {
+		return fmt.Errorf("invalid WeightedDist range: min %d > max %d", dist.min, dist.max)
+	}
+
+	dist.rng = rng
+
+	n := dist.max - dist.min + 1
+
+	weights := make([]float64, n)
+	var total float64
+	for i := 0; i < n; i++ {
+		w := float64(rng.Range(1, 1<<16))
+		if dist.biased {
+			w = w * w
+		}
+		weights[i] = w
+		total += w
+	}
+
+	// Permute the value-to-weight mapping so the heavy buckets aren't
+	// predictable from the construction parameters alone.
+	permutation := rng.Perm(n)
+	permutedWeights := make([]float64, n)
+	for i, j := range permutation {
+		permutedWeights[j] = weights[i]
+	}
+
+	values := make([]int, n)
+	cdf := make([]float64, n)
+	cumulative := 0.0
+	for i := 0; i < n; i++ {
+		values[i] = dist.min + i
+		cumulative += permutedWeights[i] / total
+		cdf[i] = cumulative
+	}
+	// Guard against floating point error leaving the final entry short of 1.
+	cdf[n-1] = 1.0
+
+	dist.values = values
+	dist.cdf = cdf
+
+	return nil
+}
+
+// Sample draws a value in [min, max] from the distribution, using the
+// distribution's rng to pick a point in the CDF and a binary search to
+// map that point to a value.
+func (dist *WeightedDist) Sample() int {
+	// As in HashDRBG.WeightedCoin, precision is only ever used in a
+	// uint64 modulo, never as an int argument, so this remains correct
+	// on 32-bit int platforms such as Android/ARM.
+	const precision = 1 << 53
+	point := float64(dist.rng.nextUint64()%precision) / float64(precision)
+	i := sort.SearchFloat64s(dist.cdf, point)
+	if i >= len(dist.values) {
+		i = len(dist.values) - 1
+	}
+	return dist.values[i]
+}
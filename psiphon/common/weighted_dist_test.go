@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2014, Psiphon Inc.
+ * All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import "testing"
+
+func TestWeightedDistRange(t *testing.T) {
+
+	rng, err := NewHashDRBG(makeTestSeed(6))
+	if err != nil {
+		t.Fatalf("NewHashDRBG failed: %s", err)
+	}
+
+	min := 10
+	max := 30
+
+	dist, err := NewWeightedDist(min, max, false, rng)
+	if err != nil {
+		t.Fatalf("NewWeightedDist failed: %s", err)
+	}
+
+	for n := 0; n < 10000; n++ {
+		v := dist.Sample()
+		if v < min || v > max {
+			t.Errorf("sample %d out of range [%d, %d]", v, min, max)
+		}
+	}
+}
+
+func TestWeightedDistDeterministic(t *testing.T) {
+
+	seed := makeTestSeed(7)
+
+	rng1, err := NewHashDRBG(seed)
+	if err != nil {
+		t.Fatalf("NewHashDRBG failed: %s", err)
+	}
+	rng2, err := NewHashDRBG(seed)
+	if err != nil {
+		t.Fatalf("NewHashDRBG failed: %s", err)
+	}
+
+	dist1, err := NewWeightedDist(0, 100, true, rng1)
+	if err != nil {
+		t.Fatalf("NewWeightedDist failed: %s", err)
+	}
+	dist2, err := NewWeightedDist(0, 100, true, rng2)
+	if err != nil {
+		t.Fatalf("NewWeightedDist failed: %s", err)
+	}
+
+	for n := 0; n < 1000; n++ {
+		v1 := dist1.Sample()
+		v2 := dist2.Sample()
+		if v1 != v2 {
+			t.Errorf("expected identical samples from identical seeds, got %d and %d", v1, v2)
+		}
+	}
+}
+
+func TestWeightedDistBiasedConcentratesMass(t *testing.T) {
+
+	rng, err := NewHashDRBG(makeTestSeed(8))
+	if err != nil {
+		t.Fatalf("NewHashDRBG failed: %s", err)
+	}
+
+	min := 0
+	max := 9
+
+	dist, err := NewWeightedDist(min, max, true, rng)
+	if err != nil {
+		t.Fatalf("NewWeightedDist failed: %s", err)
+	}
+
+	counts := make(map[int]int)
+	runs := 10000
+	for n := 0; n < runs; n++ {
+		counts[dist.Sample()]++
+	}
+
+	maxCount := 0
+	for _, c := range counts {
+		if c > maxCount {
+			maxCount = c
+		}
+	}
+
+	// With a biased (squared) weight distribution over 10 buckets, the
+	// heaviest bucket should dominate far more than a uniform 1/10 share.
+	if maxCount < runs/4 {
+		t.Errorf("expected biased distribution to concentrate mass, max bucket count was %d of %d", maxCount, runs)
+	}
+}
+
+func TestWeightedDistInvalidRange(t *testing.T) {
+
+	rng, err := NewHashDRBG(makeTestSeed(9))
+	if err != nil {
+		t.Fatalf("NewHashDRBG failed: %s", err)
+	}
+
+	_, err = NewWeightedDist(30, 10, false, rng)
+	if err == nil {
+		t.Error("expected NewWeightedDist to fail when min > max")
+	}
+}